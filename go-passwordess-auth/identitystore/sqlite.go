@@ -0,0 +1,130 @@
+package identitystore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore is the default Store.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStore opens (creating if necessary) a sqlite database at path
+// and ensures the linked_identities table exists.
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("opening identity store %q: %w", path, err)
+	}
+	const schema = `
+	CREATE TABLE IF NOT EXISTS linked_identities (
+		provider         TEXT NOT NULL,
+		provider_subject TEXT NOT NULL,
+		email            TEXT NOT NULL,
+		provider_email   TEXT,
+		linked_at        INTEGER NOT NULL,
+		PRIMARY KEY (provider, provider_subject)
+	);
+	CREATE INDEX IF NOT EXISTS idx_linked_identities_email ON linked_identities(email);`
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing identity store schema: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Link inserts or updates the identity row and checks for a conflicting
+// email in a single transaction, so two concurrent callers linking the
+// same (provider, subject) pair to different emails can't both pass the
+// check before either writes.
+func (s *SQLiteStore) Link(identity LinkedIdentity) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow(`
+		SELECT provider, provider_subject, email, provider_email, linked_at
+		FROM linked_identities WHERE provider = ? AND provider_subject = ?`,
+		identity.Provider, identity.ProviderSubject)
+	existing, err := scanIdentity(row)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil && existing.Email != identity.Email {
+		return ErrConflict
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO linked_identities (provider, provider_subject, email, provider_email, linked_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(provider, provider_subject) DO UPDATE SET
+			provider_email = excluded.provider_email,
+			linked_at      = excluded.linked_at`,
+		identity.Provider, identity.ProviderSubject, identity.Email, identity.ProviderEmail, identity.LinkedAt.Unix(),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Unlink(email, provider string) error {
+	_, err := s.db.Exec(`DELETE FROM linked_identities WHERE email = ? AND provider = ?`, email, provider)
+	return err
+}
+
+func (s *SQLiteStore) ListByEmail(email string) ([]LinkedIdentity, error) {
+	rows, err := s.db.Query(`
+		SELECT provider, provider_subject, email, provider_email, linked_at
+		FROM linked_identities WHERE email = ? ORDER BY linked_at`, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []LinkedIdentity
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, identity)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) FindByProviderSubject(provider, subject string) (LinkedIdentity, error) {
+	row := s.db.QueryRow(`
+		SELECT provider, provider_subject, email, provider_email, linked_at
+		FROM linked_identities WHERE provider = ? AND provider_subject = ?`, provider, subject)
+	identity, err := scanIdentity(row)
+	if err == sql.ErrNoRows {
+		return LinkedIdentity{}, ErrNotFound
+	}
+	return identity, err
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanIdentity(row rowScanner) (LinkedIdentity, error) {
+	var identity LinkedIdentity
+	var providerEmail sql.NullString
+	var linkedAt int64
+	if err := row.Scan(&identity.Provider, &identity.ProviderSubject, &identity.Email, &providerEmail, &linkedAt); err != nil {
+		return LinkedIdentity{}, err
+	}
+	identity.ProviderEmail = providerEmail.String
+	identity.LinkedAt = time.Unix(linkedAt, 0)
+	return identity, nil
+}
@@ -0,0 +1,45 @@
+// Package identitystore persists the link between a passwordless-verified
+// email and the social identities (OIDC/OAuth2 provider + subject) that
+// have been attached to it via the account-linking flow.
+package identitystore
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when no linked identity matches the lookup.
+var ErrNotFound = errors.New("identitystore: not found")
+
+// ErrConflict is returned by Link when the (provider, subject) pair is
+// already linked to a different email than the one being linked.
+var ErrConflict = errors.New("identitystore: identity already linked to a different email")
+
+// LinkedIdentity is one (email, provider, provider_subject) link.
+type LinkedIdentity struct {
+	Email           string
+	Provider        string
+	ProviderSubject string
+	ProviderEmail   string
+	LinkedAt        time.Time
+}
+
+// Store persists LinkedIdentity rows keyed by (provider, provider_subject).
+type Store interface {
+	// Link attaches identity to identity.Email. Linking the same
+	// (provider, subject) pair again for the same email only updates its
+	// ProviderEmail and LinkedAt; linking it to a different email returns
+	// ErrConflict.
+	Link(identity LinkedIdentity) error
+
+	Unlink(email, provider string) error
+
+	ListByEmail(email string) ([]LinkedIdentity, error)
+
+	// FindByProviderSubject looks up which email, if any, a given
+	// provider identity is linked to. Used by the social sign-in path to
+	// restore an existing account instead of creating a separate one.
+	FindByProviderSubject(provider, subject string) (LinkedIdentity, error)
+
+	Close() error
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
 	"net/mail"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
@@ -13,8 +18,56 @@ import (
 	"github.com/gofiber/session/v2"
 	"github.com/joho/godotenv"
 	"github.com/scalekit-inc/scalekit-sdk-go/v2"
+
+	"github.com/scalekit-developers/blogops-app-examples/go-passwordess-auth/identitystore"
+	"github.com/scalekit-developers/blogops-app-examples/go-passwordess-auth/providers"
+	"github.com/scalekit-developers/blogops-app-examples/go-passwordess-auth/sessionjwt"
+	"github.com/scalekit-developers/blogops-app-examples/go-passwordess-auth/tokenstore"
+)
+
+const (
+	// defaultResendCooldown is the minimum time between passwordless sends
+	// to the same email, overridable via SCALEKIT_RESEND_COOLDOWN_SECONDS.
+	defaultResendCooldown = 30 * time.Second
+	// sendWindow and maxSendsPerWindow bound how many sends an email can
+	// receive in a rolling window, independent of the per-send cooldown.
+	sendWindow        = 10 * time.Minute
+	maxSendsPerWindow = 5
+	// maxOTPAttempts locks an auth request's record after this many failed
+	// verifications, counted across /verify-otp, /verify-magic-link and
+	// /callback.
+	maxOTPAttempts = 5
 )
 
+// randomString returns a URL-safe, base64-encoded random string generated
+// from n bytes of crypto/rand, suitable for OAuth state/nonce values and
+// PKCE code verifiers.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// resendRetryAfter returns how many seconds the caller must wait before
+// another send is allowed for rec, or 0 if the cooldown has elapsed.
+func resendRetryAfter(rec tokenstore.Record, cooldown time.Duration) int {
+	remaining := cooldown - time.Since(rec.LastSentAt)
+	if remaining <= 0 {
+		return 0
+	}
+	return int(remaining.Seconds()) + 1
+}
+
+// sendsExceeded reports whether rec has hit the rolling-window send limit.
+func sendsExceeded(rec tokenstore.Record) bool {
+	if time.Since(rec.WindowStart) > sendWindow {
+		return false
+	}
+	return rec.SendCount >= maxSendsPerWindow
+}
+
 func main() {
 
 	app := fiber.New()
@@ -22,9 +75,57 @@ func main() {
 	app.Use(recover.New())
 	app.Use(logger.New())
 
-	// Session store (defaults)
+	// Session store for transient, unauthenticated flow state (pending
+	// email, in-flight auth request ids, OAuth state/nonce). The
+	// authenticated principal itself lives in signed JWT cookies, below.
 	store := session.New()
 
+	// Refresh tokens are tracked server-side (hashed) so they can be
+	// revoked and reused tokens detected.
+	refreshDBPath := os.Getenv("SCALEKIT_REFRESH_DB_PATH")
+	if refreshDBPath == "" {
+		refreshDBPath = "refresh_tokens.db"
+	}
+	refreshStore, err := sessionjwt.OpenBoltStore(refreshDBPath)
+	if err != nil {
+		log.Fatalf("Failed to open refresh token store: %v", err)
+	}
+	defer refreshStore.Close()
+	sessions, err := sessionjwt.NewManager(refreshStore)
+	if err != nil {
+		log.Fatalf("Failed to init session manager: %v", err)
+	}
+
+	// Per-email bookkeeping for in-flight passwordless auth requests:
+	// powers resend throttling, /resend-auth, and OTP attempt lockout.
+	tokenDBPath := os.Getenv("SCALEKIT_TOKEN_STORE_PATH")
+	if tokenDBPath == "" {
+		tokenDBPath = "auth_tokens.db"
+	}
+	tokens, err := tokenstore.OpenSQLiteStore(tokenDBPath)
+	if err != nil {
+		log.Fatalf("Failed to open token store: %v", err)
+	}
+	defer tokens.Close()
+	resendCooldown := defaultResendCooldown
+	if raw := os.Getenv("SCALEKIT_RESEND_COOLDOWN_SECONDS"); raw != "" {
+		if secs, err := strconv.Atoi(raw); err == nil {
+			resendCooldown = time.Duration(secs) * time.Second
+		}
+	}
+
+	// Links between a passwordless-verified email and the social identities
+	// attached to it via the account-linking flow below.
+	identityDBPath := os.Getenv("SCALEKIT_IDENTITY_STORE_PATH")
+	if identityDBPath == "" {
+		identityDBPath = "linked_identities.db"
+	}
+	identities, err := identitystore.OpenSQLiteStore(identityDBPath)
+	if err != nil {
+		log.Fatalf("Failed to open identity store: %v", err)
+	}
+	defer identities.Close()
+
 	// Load .env file once
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found or error loading .env")
@@ -41,6 +142,30 @@ func main() {
 		clientSecret,
 	)
 
+	// Allow-list of hosts the post-verification `redirect` query param may
+	// point to, e.g. "app.example.com,.example.com" (a leading "." allow-lists
+	// every subdomain). Unset means no absolute redirect URL is permitted;
+	// same-site relative paths ("/docs") are accepted either way.
+	var allowedRedirectDomains []string
+	if raw := os.Getenv("SCALEKIT_ALLOWED_REDIRECT_DOMAINS"); raw != "" {
+		allowedRedirectDomains = strings.Split(raw, ",")
+	}
+
+	// appBaseURL is this app's own origin, e.g. "https://myapp.com". It is
+	// distinct from SCALEKIT_REDIRECT_URI (the full passwordless magic-link
+	// callback URL) and is used to compute each social provider's
+	// redirect_uri for both the sign-in and account-linking flows.
+	appBaseURL := os.Getenv("SCALEKIT_APP_BASE_URL")
+
+	// Social sign-in providers (Google, GitHub, Keycloak, ...), discovered
+	// from PROVIDER_<NAME>_* env vars. This is optional: an app that only
+	// wants magic-link/OTP can simply leave these env vars unset.
+	socialProviders, err := providers.LoadFromEnv(appBaseURL)
+	if err != nil {
+		log.Fatalf("Failed to load social sign-in providers: %v", err)
+	}
+	log.Printf("Loaded %d social sign-in provider(s)", len(socialProviders))
+
 	// Unified /request-auth endpoint (handles magic link or OTP)
 	app.Post("/request-auth", func(c *fiber.Ctx) error {
 		type reqBody struct {
@@ -60,6 +185,22 @@ func main() {
 			log.Println("Invalid email format for /request-auth")
 			return c.Status(400).JSON(fiber.Map{"error": "Invalid email"})
 		}
+
+		existing, err := tokens.Get(email)
+		if err == nil {
+			if retryAfter := resendRetryAfter(existing, resendCooldown); retryAfter > 0 {
+				c.Set("Retry-After", strconv.Itoa(retryAfter))
+				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Please wait before requesting another code"})
+			}
+			if sendsExceeded(existing) {
+				c.Set("Retry-After", strconv.Itoa(int(sendWindow.Seconds())))
+				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Too many requests for this email, please try again later"})
+			}
+		} else if err != tokenstore.ErrNotFound {
+			log.Printf("Token store error for %s: %v", email, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Internal error"})
+		}
+
 		// Ask Scalekit backend to handle appropriate flow
 		templateType := scalekit.TemplateTypeSignin
 		resp, err := scalekitClient.Passwordless().SendPasswordlessEmail(
@@ -77,6 +218,25 @@ func main() {
 			log.Printf("Error sending passwordless email for %s: %v", email, err)
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to send passwordless email"})
 		}
+
+		now := time.Now()
+		rec := tokenstore.Record{
+			Email:         email,
+			AuthRequestId: resp.AuthRequestId,
+			CreatedAt:     now,
+			ExpiresAt:     now.Add(10 * time.Minute),
+			LastSentAt:    now,
+			WindowStart:   now,
+			SendCount:     1,
+		}
+		if existing.WindowStart.Add(sendWindow).After(now) {
+			rec.WindowStart = existing.WindowStart
+			rec.SendCount = existing.SendCount + 1
+		}
+		if err := tokens.Upsert(rec); err != nil {
+			log.Printf("Failed to record token store entry for %s: %v", email, err)
+		}
+
 		// Store authRequestId and pending email in session
 		sess := store.Get(c)
 		if sess == nil {
@@ -90,6 +250,192 @@ func main() {
 		return c.JSON(fiber.Map{"message": "Passwordless email sent! Check your email.", "email": email})
 	})
 
+	// POST /resend-auth reuses the existing auth_request_id for email if
+	// it's still valid, instead of minting a new passwordless request, so
+	// an already-delivered OTP/magic-link remains usable after a resend.
+	app.Post("/resend-auth", func(c *fiber.Ctx) error {
+		type reqBody struct {
+			Email string `json:"email"`
+		}
+		var body reqBody
+		if err := c.BodyParser(&body); err != nil || body.Email == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Email required"})
+		}
+		email := body.Email
+
+		rec, err := tokens.Get(email)
+		if err == tokenstore.ErrNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "No pending auth request for this email. Please request auth again."})
+		} else if err != nil {
+			log.Printf("Token store error for %s: %v", email, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Internal error"})
+		}
+		if rec.Locked {
+			return c.Status(423).JSON(fiber.Map{"error": "Too many failed attempts. Please request auth again."})
+		}
+		if rec.Consumed() {
+			return c.Status(400).JSON(fiber.Map{"error": "Already verified."})
+		}
+		if rec.Expired() {
+			return c.Status(400).JSON(fiber.Map{"error": "Auth request expired. Please request auth again."})
+		}
+		if retryAfter := resendRetryAfter(rec, resendCooldown); retryAfter > 0 {
+			c.Set("Retry-After", strconv.Itoa(retryAfter))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Please wait before requesting another code"})
+		}
+		if sendsExceeded(rec) {
+			c.Set("Retry-After", strconv.Itoa(int(sendWindow.Seconds())))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Too many requests for this email, please try again later"})
+		}
+
+		if _, err := scalekitClient.Passwordless().ResendPasswordlessEmail(c.Context(), rec.AuthRequestId); err != nil {
+			log.Printf("Error resending passwordless email for %s: %v", email, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to resend passwordless email"})
+		}
+
+		now := time.Now()
+		rec.LastSentAt = now
+		rec.SendCount++
+		if err := tokens.Upsert(rec); err != nil {
+			log.Printf("Failed to update token store entry for %s: %v", email, err)
+		}
+
+		sess := store.Get(c)
+		if sess != nil {
+			sess.Set("authRequestId:"+email, rec.AuthRequestId)
+			sess.Set("pendingEmail", email)
+			sess.Save()
+		}
+		log.Printf("Passwordless email resent to %s, authRequestId: %v", email, rec.AuthRequestId)
+		return c.JSON(fiber.Map{"message": "Passwordless email resent! Check your email.", "email": email})
+	})
+
+	// GET /auth/:provider - kick off a social sign-in. Generates state,
+	// nonce and a PKCE verifier, stashes them in the session keyed by
+	// provider (so concurrent logins against different providers don't
+	// clobber each other), and redirects to the provider's authorize URL.
+	app.Get("/auth/:provider", func(c *fiber.Ctx) error {
+		name := c.Params("provider")
+		provider, ok := socialProviders[name]
+		if !ok {
+			return c.Status(404).JSON(fiber.Map{"error": "Unknown provider: " + name})
+		}
+		sess := store.Get(c)
+		if sess == nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Session error"})
+		}
+		redirectTo := c.Query("redirect")
+		if redirectTo != "" && !isValidRedirect(redirectTo, allowedRedirectDomains) {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid redirect target"})
+		}
+		state, err := randomString(32)
+		if err != nil {
+			log.Printf("Error generating state for provider %s: %v", name, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to start sign-in"})
+		}
+		nonce, err := randomString(32)
+		if err != nil {
+			log.Printf("Error generating nonce for provider %s: %v", name, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to start sign-in"})
+		}
+		var codeVerifier string
+		if provider.SupportsPKCE() {
+			codeVerifier, err = randomString(48)
+			if err != nil {
+				log.Printf("Error generating PKCE verifier for provider %s: %v", name, err)
+				return c.Status(500).JSON(fiber.Map{"error": "Failed to start sign-in"})
+			}
+		}
+		sess.Set("oauth:"+name+":state", state)
+		sess.Set("oauth:"+name+":nonce", nonce)
+		sess.Set("oauth:"+name+":verifier", codeVerifier)
+		sess.Set("oauth:"+name+":redirect", redirectTo)
+		sess.Save()
+		authURL := provider.AuthURL(state, nonce, codeVerifier, providers.SignInCallbackURL(appBaseURL, name))
+		return c.Redirect(authURL, fiber.StatusFound)
+	})
+
+	// GET /auth/:provider/callback - completes a social sign-in: validates
+	// state, exchanges the code, verifies the ID token (issuer, audience and
+	// signature are checked inside providers.UserInfo for OIDC providers;
+	// the nonce it returns is compared against the stashed one here), and
+	// writes an authenticated session keyed by email
+	// so /whoami works the same way as for the passwordless flow.
+	app.Get("/auth/:provider/callback", func(c *fiber.Ctx) error {
+		name := c.Params("provider")
+		provider, ok := socialProviders[name]
+		if !ok {
+			return c.Status(404).JSON(fiber.Map{"error": "Unknown provider: " + name})
+		}
+		sess := store.Get(c)
+		if sess == nil {
+			return c.Status(400).JSON(fiber.Map{"error": "No session found. Please sign in again."})
+		}
+		expectedState, _ := sess.Get("oauth:" + name + ":state").(string)
+		if expectedState == "" || c.Query("state") != expectedState {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid or expired state"})
+		}
+		nonce, _ := sess.Get("oauth:" + name + ":nonce").(string)
+		codeVerifier, _ := sess.Get("oauth:" + name + ":verifier").(string)
+		redirectTo, _ := sess.Get("oauth:" + name + ":redirect").(string)
+		sess.Delete("oauth:" + name + ":state")
+		sess.Delete("oauth:" + name + ":nonce")
+		sess.Delete("oauth:" + name + ":verifier")
+		sess.Delete("oauth:" + name + ":redirect")
+
+		code := c.Query("code")
+		if code == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Missing code"})
+		}
+		oauthTokens, err := provider.Exchange(c.Context(), code, codeVerifier, providers.SignInCallbackURL(appBaseURL, name))
+		if err != nil {
+			log.Printf("OAuth exchange failed for provider %s: %v", name, err)
+			return c.Status(401).JSON(fiber.Map{"error": "Sign-in failed"})
+		}
+		identity, err := provider.UserInfo(c.Context(), oauthTokens)
+		if err != nil {
+			log.Printf("OAuth userinfo failed for provider %s: %v", name, err)
+			return c.Status(401).JSON(fiber.Map{"error": "Sign-in failed"})
+		}
+		if provider.IsOIDC() && (identity.Nonce == "" || identity.Nonce != nonce) {
+			log.Printf("Nonce mismatch for provider %s", name)
+			return c.Status(401).JSON(fiber.Map{"error": "Sign-in failed"})
+		}
+		if identity.Email == "" {
+			return c.Status(401).JSON(fiber.Map{"error": "Provider did not return an email address"})
+		}
+		if !identity.EmailVerified {
+			log.Printf("Rejecting sign-in via %s: email %s not verified by provider", name, identity.Email)
+			return c.Status(401).JSON(fiber.Map{"error": "Provider email address is not verified"})
+		}
+
+		// If this provider identity was previously linked to an account via
+		// /account/link, sign in as that account instead of treating this
+		// as a fresh identity, even if the provider's email has since changed.
+		signInEmail := identity.Email
+		if linked, err := identities.FindByProviderSubject(name, identity.Subject); err == nil {
+			signInEmail = linked.Email
+		} else if err != identitystore.ErrNotFound {
+			log.Printf("Identity store error for provider %s subject %s: %v", name, identity.Subject, err)
+		}
+
+		if err := sessions.IssueSession(c, signInEmail); err != nil {
+			log.Printf("Failed to issue session for %s: %v", identity.Email, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to start session"})
+		}
+		sess.Delete("pendingEmail")
+		sess.Save()
+		log.Printf("User authenticated via %s: %s", name, signInEmail)
+		if redirectTo != "" {
+			// Already validated in /auth/:provider before being stashed in
+			// the session, but re-check in case the stored value was tampered with.
+			if isValidRedirect(redirectTo, allowedRedirectDomains) {
+				return c.Redirect(redirectTo, fiber.StatusFound)
+			}
+		}
+		return c.JSON(fiber.Map{"message": "Signed in via " + name, "email": signInEmail})
+	})
+
 	// Start pprof server for profiling (on :6060)
 	go func() {
 		log.Println("pprof profiling enabled at :6060")
@@ -107,16 +453,18 @@ func main() {
 	// Magic link callback endpoint for browser-based flows
 	// Example: GET /callback?link_token=...&redirect=/docs
 	app.Get("/callback", func(c *fiber.Ctx) error {
+		// Optional redirect target, defaults to /docs. Anything else must
+		// pass isValidRedirect to guard against open redirects.
+		redirectTo := c.Query("redirect")
+		if redirectTo == "" {
+			redirectTo = "/docs"
+		} else if !isValidRedirect(redirectTo, allowedRedirectDomains) {
+			return c.Status(400).Type("html").SendString("Invalid redirect target.")
+		}
+
 		// If already authenticated, redirect immediately
-		sess := store.Get(c)
-		if sess != nil {
-			if authedEmail, ok := sess.Get("email").(string); ok && authedEmail != "" {
-				redirectTo := c.Query("redirect")
-				if redirectTo == "" {
-					redirectTo = "/docs"
-				}
-				return c.Redirect(redirectTo, fiber.StatusFound)
-			}
+		if authedEmail, err := sessions.Authenticate(c); err == nil && authedEmail != "" {
+			return c.Redirect(redirectTo, fiber.StatusFound)
 		}
 		// Read link_token from query
 		token := c.Query("link_token")
@@ -128,17 +476,8 @@ func main() {
 			return c.Status(400).Type("html").SendString("Missing link_token. Please use the link from your email.")
 		}
 
-		// Optional redirect target, defaults to /docs
-		redirectTo := c.Query("redirect")
-		if redirectTo == "" {
-			redirectTo = "/docs"
-		}
-
 		// Retrieve authRequestId from session (created by /request-auth)
-		// Reuse the session obtained above or fetch if nil
-		if sess == nil {
-			sess = store.Get(c)
-		}
+		sess := store.Get(c)
 		if sess == nil {
 			return c.Status(400).Type("html").SendString("No session found. Please start from /request-auth again.")
 		}
@@ -158,6 +497,18 @@ func main() {
 			}
 		}
 
+		if tokenRec, err := tokens.Get(email); err == nil {
+			if tokenRec.Locked {
+				return c.Status(423).Type("html").SendString("Too many failed attempts. Please request a new magic link.")
+			}
+			if tokenRec.Consumed() {
+				return c.Status(401).Type("html").SendString("This magic link has already been used.")
+			}
+		} else if err != tokenstore.ErrNotFound {
+			log.Printf("Token store error for %s: %v", email, err)
+			return c.Status(500).Type("html").SendString("Internal error.")
+		}
+
 		// Verify with Scalekit
 		_, err := scalekitClient.Passwordless().VerifyPasswordlessEmail(
 			c.Context(),
@@ -168,11 +519,20 @@ func main() {
 		)
 		if err != nil {
 			log.Printf("Callback verify failed: %v", err)
+			if rec, incErr := tokens.IncrementAttempts(email, maxOTPAttempts); incErr == nil && rec.Locked {
+				return c.Status(423).Type("html").SendString("Too many failed attempts. Please request a new magic link.")
+			}
 			return c.Status(401).Type("html").SendString("Magic link invalid or expired. Please request a new one.")
 		}
+		if err := tokens.MarkConsumed(email, tokenstore.TypeMagicLink); err != nil {
+			log.Printf("Failed to mark token consumed for %s: %v", email, err)
+		}
 
-		// Promote session to authenticated and clear pending markers
-		sess.Set("email", email)
+		// Promote to an authenticated session and clear pending markers
+		if err := sessions.IssueSession(c, email); err != nil {
+			log.Printf("Failed to issue session for %s: %v", email, err)
+			return c.Status(500).Type("html").SendString("Failed to start session.")
+		}
 		sess.Delete("pendingEmail")
 		sess.Delete("authRequestId:" + email)
 		sess.Save()
@@ -264,10 +624,8 @@ func main() {
 	// Verify OTP (only OTP, email and authRequestId from session)
 	app.Post("/verify-otp", func(c *fiber.Ctx) error {
 		// If already authenticated, short-circuit
-		if s := store.Get(c); s != nil {
-			if authedEmail, ok := s.Get("email").(string); ok && authedEmail != "" {
-				return c.JSON(fiber.Map{"message": "Already authenticated", "email": authedEmail})
-			}
+		if authedEmail, err := sessions.Authenticate(c); err == nil && authedEmail != "" {
+			return c.JSON(fiber.Map{"message": "Already authenticated", "email": authedEmail})
 		}
 		type reqBody struct {
 			OTP string `json:"otp"`
@@ -298,8 +656,21 @@ func main() {
 			log.Println("No authRequestId found in session for email: " + email)
 			return c.Status(400).JSON(fiber.Map{"error": "No OTP request found for this email. Please request OTP again."})
 		}
+		tokenRec, err := tokens.Get(email)
+		if err == nil {
+			if tokenRec.Locked {
+				return c.Status(423).JSON(fiber.Map{"error": "Too many failed attempts. Please request auth again."})
+			}
+			if tokenRec.Consumed() {
+				return c.Status(401).JSON(fiber.Map{"error": "This code has already been used."})
+			}
+		} else if err != tokenstore.ErrNotFound {
+			log.Printf("Token store error for %s: %v", email, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Internal error"})
+		}
+
 		log.Printf("OTP verification attempt for email: %s, otp: %s, authRequestId: %s", email, otp, authRequestId)
-		_, err := scalekitClient.Passwordless().VerifyPasswordlessEmail(
+		_, err = scalekitClient.Passwordless().VerifyPasswordlessEmail(
 			c.Context(),
 			&scalekit.VerifyPasswordlessOptions{
 				Code:          otp,
@@ -308,10 +679,19 @@ func main() {
 		)
 		if err != nil {
 			log.Printf("OTP verification failed for %s: %v", email, err)
+			if rec, incErr := tokens.IncrementAttempts(email, maxOTPAttempts); incErr == nil && rec.Locked {
+				return c.Status(423).JSON(fiber.Map{"error": "Too many failed attempts. Please request auth again."})
+			}
 			return c.Status(401).JSON(fiber.Map{"error": "Invalid OTP"})
 		}
+		if err := tokens.MarkConsumed(email, tokenstore.TypeOTP); err != nil {
+			log.Printf("Failed to mark token consumed for %s: %v", email, err)
+		}
 		// Create session and clear pending markers
-		sess.Set("email", email)
+		if err := sessions.IssueSession(c, email); err != nil {
+			log.Printf("Failed to issue session for %s: %v", email, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to start session"})
+		}
 		sess.Delete("pendingEmail")
 		sess.Delete("authRequestId:" + email)
 		sess.Save()
@@ -322,10 +702,8 @@ func main() {
 	// Verify Magic Link (accepts only token from the magic link URL: link_token)
 	app.Post("/verify-magic-link", func(c *fiber.Ctx) error {
 		// If already authenticated, short-circuit
-		if s := store.Get(c); s != nil {
-			if authedEmail, ok := s.Get("email").(string); ok && authedEmail != "" {
-				return c.JSON(fiber.Map{"message": "Already authenticated", "email": authedEmail})
-			}
+		if authedEmail, err := sessions.Authenticate(c); err == nil && authedEmail != "" {
+			return c.JSON(fiber.Map{"message": "Already authenticated", "email": authedEmail})
 		}
 		type reqBody struct {
 			Token string `json:"token"`
@@ -356,8 +734,21 @@ func main() {
 			log.Println("No authRequestId found in session for magic link verify")
 			return c.Status(400).JSON(fiber.Map{"error": "Missing auth request. Please request auth again."})
 		}
+		tokenRec, err := tokens.Get(email)
+		if err == nil {
+			if tokenRec.Locked {
+				return c.Status(423).JSON(fiber.Map{"error": "Too many failed attempts. Please request auth again."})
+			}
+			if tokenRec.Consumed() {
+				return c.Status(401).JSON(fiber.Map{"error": "This magic link has already been used."})
+			}
+		} else if err != tokenstore.ErrNotFound {
+			log.Printf("Token store error for %s: %v", email, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Internal error"})
+		}
+
 		log.Printf("Magic link verification attempt: authRequestId=%s", authRequestId)
-		_, err := scalekitClient.Passwordless().VerifyPasswordlessEmail(
+		_, err = scalekitClient.Passwordless().VerifyPasswordlessEmail(
 			c.Context(),
 			&scalekit.VerifyPasswordlessOptions{
 				LinkToken:     token,
@@ -366,10 +757,19 @@ func main() {
 		)
 		if err != nil {
 			log.Printf("Magic link verification failed: %v", err)
+			if rec, incErr := tokens.IncrementAttempts(email, maxOTPAttempts); incErr == nil && rec.Locked {
+				return c.Status(423).JSON(fiber.Map{"error": "Too many failed attempts. Please request auth again."})
+			}
 			return c.Status(401).JSON(fiber.Map{"error": "Invalid magic link or request ID"})
 		}
+		if err := tokens.MarkConsumed(email, tokenstore.TypeMagicLink); err != nil {
+			log.Printf("Failed to mark token consumed for %s: %v", email, err)
+		}
 		// Promote pending email to authenticated and clear pending markers
-		sess.Set("email", email)
+		if err := sessions.IssueSession(c, email); err != nil {
+			log.Printf("Failed to issue session for %s: %v", email, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to start session"})
+		}
 		sess.Delete("pendingEmail")
 		sess.Delete("authRequestId:" + email)
 		sess.Save()
@@ -378,29 +778,174 @@ func main() {
 	})
 
 	// Whoami endpoint: returns current signed-in user's email or not authorized
-	app.Get("/whoami", func(c *fiber.Ctx) error {
+	app.Get("/whoami", sessions.RequireAuth(), func(c *fiber.Ctx) error {
+		email, _ := c.Locals(sessionjwt.LocalsEmailKey).(string)
+		linked, err := identities.ListByEmail(email)
+		if err != nil {
+			log.Printf("Identity store error listing identities for %s: %v", email, err)
+		}
+		return c.JSON(fiber.Map{
+			"email":      email,
+			"identities": linked,
+		})
+	})
+
+	// POST /account/link/:provider/start begins linking a social identity to
+	// the currently signed-in (passwordless or social) account. Unlike
+	// /auth/:provider, this returns the authorize URL as JSON rather than
+	// redirecting, since it's meant to be called from an already-authenticated
+	// session (e.g. an account settings page) rather than a bare browser nav.
+	app.Post("/account/link/:provider/start", sessions.RequireAuth(), func(c *fiber.Ctx) error {
+		name := c.Params("provider")
+		provider, ok := socialProviders[name]
+		if !ok {
+			return c.Status(404).JSON(fiber.Map{"error": "Unknown provider: " + name})
+		}
+		email, _ := c.Locals(sessionjwt.LocalsEmailKey).(string)
 		sess := store.Get(c)
 		if sess == nil {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Not authorized",
-			})
+			return c.Status(500).JSON(fiber.Map{"error": "Session error"})
 		}
-		email, ok := sess.Get("email").(string)
-		if !ok || email == "" {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Not authorized",
-			})
+		state, err := randomString(32)
+		if err != nil {
+			log.Printf("Error generating state for link provider %s: %v", name, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to start account linking"})
 		}
-		return c.JSON(fiber.Map{
-			"email": email,
+		nonce, err := randomString(32)
+		if err != nil {
+			log.Printf("Error generating nonce for link provider %s: %v", name, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to start account linking"})
+		}
+		var codeVerifier string
+		if provider.SupportsPKCE() {
+			codeVerifier, err = randomString(48)
+			if err != nil {
+				log.Printf("Error generating PKCE verifier for link provider %s: %v", name, err)
+				return c.Status(500).JSON(fiber.Map{"error": "Failed to start account linking"})
+			}
+		}
+		sess.Set("link:"+name+":state", state)
+		sess.Set("link:"+name+":nonce", nonce)
+		sess.Set("link:"+name+":verifier", codeVerifier)
+		sess.Set("link:"+name+":email", email)
+		sess.Save()
+		authURL := provider.AuthURL(state, nonce, codeVerifier, providers.LinkCallbackURL(appBaseURL, name))
+		return c.JSON(fiber.Map{"url": authURL})
+	})
+
+	// GET /account/link/:provider/callback completes the account-linking
+	// flow started above. It does not itself require RequireAuth, since the
+	// browser redirect back from the provider carries no auth cookie
+	// guarantee beyond the session state stashed at /start; the email being
+	// linked to is instead recovered from that stashed session state.
+	app.Get("/account/link/:provider/callback", func(c *fiber.Ctx) error {
+		name := c.Params("provider")
+		provider, ok := socialProviders[name]
+		if !ok {
+			return c.Status(404).JSON(fiber.Map{"error": "Unknown provider: " + name})
+		}
+		sess := store.Get(c)
+		if sess == nil {
+			return c.Status(400).JSON(fiber.Map{"error": "No session found. Please start linking again."})
+		}
+		expectedState, _ := sess.Get("link:" + name + ":state").(string)
+		if expectedState == "" || c.Query("state") != expectedState {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid or expired state"})
+		}
+		nonce, _ := sess.Get("link:" + name + ":nonce").(string)
+		codeVerifier, _ := sess.Get("link:" + name + ":verifier").(string)
+		email, _ := sess.Get("link:" + name + ":email").(string)
+		sess.Delete("link:" + name + ":state")
+		sess.Delete("link:" + name + ":nonce")
+		sess.Delete("link:" + name + ":verifier")
+		sess.Delete("link:" + name + ":email")
+		sess.Save()
+		if email == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "No account-linking request found. Please start linking again."})
+		}
+
+		code := c.Query("code")
+		if code == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Missing code"})
+		}
+		oauthTokens, err := provider.Exchange(c.Context(), code, codeVerifier, providers.LinkCallbackURL(appBaseURL, name))
+		if err != nil {
+			log.Printf("OAuth exchange failed for link provider %s: %v", name, err)
+			return c.Status(401).JSON(fiber.Map{"error": "Account linking failed"})
+		}
+		identity, err := provider.UserInfo(c.Context(), oauthTokens)
+		if err != nil {
+			log.Printf("OAuth userinfo failed for link provider %s: %v", name, err)
+			return c.Status(401).JSON(fiber.Map{"error": "Account linking failed"})
+		}
+		if provider.IsOIDC() && (identity.Nonce == "" || identity.Nonce != nonce) {
+			log.Printf("Nonce mismatch for link provider %s", name)
+			return c.Status(401).JSON(fiber.Map{"error": "Account linking failed"})
+		}
+		if !identity.EmailVerified {
+			log.Printf("Rejecting link via %s: email %s not verified by provider", name, identity.Email)
+			return c.Status(401).JSON(fiber.Map{"error": "Provider email address is not verified"})
+		}
+
+		err = identities.Link(identitystore.LinkedIdentity{
+			Email:           email,
+			Provider:        name,
+			ProviderSubject: identity.Subject,
+			ProviderEmail:   identity.Email,
+			LinkedAt:        time.Now(),
 		})
+		if err == identitystore.ErrConflict {
+			return c.Status(409).JSON(fiber.Map{"error": "This " + name + " account is already linked to a different user"})
+		} else if err != nil {
+			log.Printf("Failed to link %s identity for %s: %v", name, email, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to link account"})
+		}
+		log.Printf("Linked %s identity to %s", name, email)
+		return c.JSON(fiber.Map{"message": "Linked " + name + " to account", "email": email})
+	})
+
+	// DELETE /account/link/:provider removes a previously linked identity
+	// from the signed-in account.
+	app.Delete("/account/link/:provider", sessions.RequireAuth(), func(c *fiber.Ctx) error {
+		name := c.Params("provider")
+		email, _ := c.Locals(sessionjwt.LocalsEmailKey).(string)
+		if err := identities.Unlink(email, name); err != nil {
+			log.Printf("Failed to unlink %s identity for %s: %v", name, email, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to unlink account"})
+		}
+		return c.JSON(fiber.Map{"message": "Unlinked " + name + " from account"})
 	})
 
-	// Logout
+	// GET /account/identities lists the social identities linked to the
+	// signed-in account.
+	app.Get("/account/identities", sessions.RequireAuth(), func(c *fiber.Ctx) error {
+		email, _ := c.Locals(sessionjwt.LocalsEmailKey).(string)
+		linked, err := identities.ListByEmail(email)
+		if err != nil {
+			log.Printf("Identity store error listing identities for %s: %v", email, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to list linked identities"})
+		}
+		return c.JSON(fiber.Map{"identities": linked})
+	})
+
+	// Rotates the refresh token cookie and issues a fresh access token.
+	// The presented refresh token is single-use; replaying one that was
+	// already rotated revokes the whole chain (see sessionjwt.Manager.Refresh).
+	app.Post("/auth/refresh", func(c *fiber.Ctx) error {
+		email, err := sessions.Refresh(c)
+		if err != nil {
+			log.Printf("Refresh failed: %v", err)
+			return c.Status(401).JSON(fiber.Map{"error": "Invalid or expired refresh token"})
+		}
+		return c.JSON(fiber.Map{"message": "Session refreshed", "email": email})
+	})
+
+	// Logout: revoke the server-side refresh record and clear cookies
 	app.Get("/logout", func(c *fiber.Ctx) error {
-		sess := store.Get(c)
-		if sess != nil {
-			log.Printf("User logged out: %v", sess.Get("email"))
+		if err := sessions.Revoke(c); err != nil {
+			log.Printf("Error revoking session on logout: %v", err)
+		}
+		if sess := store.Get(c); sess != nil {
 			sess.Destroy()
 		}
 		return c.SendString("Logged out. Use /request-auth to log in again.")
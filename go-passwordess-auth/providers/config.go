@@ -0,0 +1,114 @@
+package providers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// config is the raw shape read from PROVIDER_<NAME>_* env vars before a
+// concrete Provider is constructed from it.
+type config struct {
+	name         string
+	clientID     string
+	clientSecret string
+	issuer       string // OIDC providers only
+	authURL      string // raw OAuth2 providers only
+	tokenURL     string // raw OAuth2 providers only
+	userInfoURL  string // raw OAuth2 providers only
+	emailsURL    string // raw OAuth2 providers only; optional email fallback
+	scopes       []string
+	redirectURI  string
+}
+
+// SignInCallbackURL is the redirect_uri registered with name's IdP for the
+// social sign-in flow (GET /auth/:provider/callback), relative to
+// appBaseURL (e.g. "https://myapp.com").
+func SignInCallbackURL(appBaseURL, name string) string {
+	return strings.TrimRight(appBaseURL, "/") + "/auth/" + strings.ToLower(name) + "/callback"
+}
+
+// LinkCallbackURL is the redirect_uri used for the account-linking flow
+// (GET /account/link/:provider/callback). It must be registered with the
+// IdP as an additional allowed redirect URI alongside SignInCallbackURL.
+func LinkCallbackURL(appBaseURL, name string) string {
+	return strings.TrimRight(appBaseURL, "/") + "/account/link/" + strings.ToLower(name) + "/callback"
+}
+
+// knownRawOAuth2Providers lists providers we talk to via plain OAuth2
+// (no OIDC discovery document available). emailsURL is optional: it's
+// consulted as a fallback when userInfoURL doesn't return an email (e.g.
+// GitHub omits it for accounts with a private primary email).
+var knownRawOAuth2Providers = map[string]struct {
+	authURL, tokenURL, userInfoURL, emailsURL string
+}{
+	"github": {
+		authURL:     "https://github.com/login/oauth/authorize",
+		tokenURL:    "https://github.com/login/oauth/access_token",
+		userInfoURL: "https://api.github.com/user",
+		emailsURL:   "https://api.github.com/user/emails",
+	},
+	"bitbucket": {
+		authURL:     "https://bitbucket.org/site/oauth2/authorize",
+		tokenURL:    "https://bitbucket.org/site/oauth2/access_token",
+		userInfoURL: "https://api.bitbucket.org/2.0/user",
+	},
+}
+
+// LoadFromEnv discovers configured providers by scanning for
+// PROVIDER_<NAME>_CLIENT_ID env vars and builds a Provider for each one
+// found. Providers with an ISSUER are treated as OIDC; the rest fall back
+// to the static raw-OAuth2 endpoints in knownRawOAuth2Providers.
+//
+// appBaseURL is this app's own origin (e.g. "https://myapp.com"), used to
+// compute each provider's default redirect_uri via SignInCallbackURL. It
+// is distinct from SCALEKIT_REDIRECT_URI, which is the full passwordless
+// magic-link callback URL and has nothing to do with social sign-in.
+//
+// Example env vars for Google:
+//
+//	PROVIDER_GOOGLE_CLIENT_ID=...
+//	PROVIDER_GOOGLE_CLIENT_SECRET=...
+//	PROVIDER_GOOGLE_ISSUER=https://accounts.google.com
+//	PROVIDER_GOOGLE_SCOPES=openid,email,profile
+func LoadFromEnv(appBaseURL string) (map[string]Provider, error) {
+	names := map[string]struct{}{}
+	for _, kv := range os.Environ() {
+		key := strings.SplitN(kv, "=", 2)[0]
+		if !strings.HasPrefix(key, "PROVIDER_") || !strings.HasSuffix(key, "_CLIENT_ID") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "PROVIDER_"), "_CLIENT_ID")
+		names[name] = struct{}{}
+	}
+
+	out := make(map[string]Provider, len(names))
+	for name := range names {
+		cfg := config{
+			name:         strings.ToLower(name),
+			clientID:     os.Getenv("PROVIDER_" + name + "_CLIENT_ID"),
+			clientSecret: os.Getenv("PROVIDER_" + name + "_CLIENT_SECRET"),
+			issuer:       os.Getenv("PROVIDER_" + name + "_ISSUER"),
+			redirectURI:  SignInCallbackURL(appBaseURL, name),
+		}
+		if scopes := os.Getenv("PROVIDER_" + name + "_SCOPES"); scopes != "" {
+			cfg.scopes = strings.Split(scopes, ",")
+		}
+
+		var p Provider
+		var err error
+		if cfg.issuer != "" {
+			p, err = newOIDCProvider(cfg)
+		} else if raw, ok := knownRawOAuth2Providers[cfg.name]; ok {
+			cfg.authURL, cfg.tokenURL, cfg.userInfoURL, cfg.emailsURL = raw.authURL, raw.tokenURL, raw.userInfoURL, raw.emailsURL
+			p, err = newOAuth2Provider(cfg)
+		} else {
+			err = fmt.Errorf("provider %q has no ISSUER and is not a known raw-OAuth2 provider", cfg.name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("loading provider %q: %w", cfg.name, err)
+		}
+		out[cfg.name] = p
+	}
+	return out, nil
+}
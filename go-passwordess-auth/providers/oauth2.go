@@ -0,0 +1,186 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// oauth2Provider wraps a plain OAuth2 provider that has no OIDC discovery
+// document (GitHub, Bitbucket). There is no ID token to verify, so
+// UserInfo calls the provider's REST userinfo endpoint directly with the
+// access token.
+type oauth2Provider struct {
+	cfg         config
+	oauth2      *oauth2.Config
+	userInfoURL string
+	emailsURL   string
+}
+
+func newOAuth2Provider(cfg config) (*oauth2Provider, error) {
+	scopes := cfg.scopes
+	if len(scopes) == 0 {
+		scopes = []string{"read:user", "user:email"}
+	}
+	return &oauth2Provider{
+		cfg: cfg,
+		oauth2: &oauth2.Config{
+			ClientID:     cfg.clientID,
+			ClientSecret: cfg.clientSecret,
+			RedirectURL:  cfg.redirectURI,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  cfg.authURL,
+				TokenURL: cfg.tokenURL,
+			},
+			Scopes: scopes,
+		},
+		userInfoURL: cfg.userInfoURL,
+		emailsURL:   cfg.emailsURL,
+	}, nil
+}
+
+func (p *oauth2Provider) Name() string       { return p.cfg.name }
+func (p *oauth2Provider) SupportsPKCE() bool { return false }
+func (p *oauth2Provider) IsOIDC() bool       { return false }
+
+func (p *oauth2Provider) AuthURL(state, _, codeVerifier, redirectURI string) string {
+	opts := []oauth2.AuthCodeOption{}
+	if codeVerifier != "" {
+		opts = append(opts, oauth2.S256ChallengeOption(codeVerifier))
+	}
+	if redirectURI != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("redirect_uri", redirectURI))
+	}
+	return p.oauth2.AuthCodeURL(state, opts...)
+}
+
+func (p *oauth2Provider) Exchange(ctx context.Context, code, codeVerifier, redirectURI string) (*Tokens, error) {
+	opts := []oauth2.AuthCodeOption{}
+	if codeVerifier != "" {
+		opts = append(opts, oauth2.VerifierOption(codeVerifier))
+	}
+	if redirectURI != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("redirect_uri", redirectURI))
+	}
+	tok, err := p.oauth2.Exchange(ctx, code, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: exchanging code: %w", p.cfg.name, err)
+	}
+	return &Tokens{
+		AccessToken:  tok.AccessToken,
+		RefreshToken: tok.RefreshToken,
+		ExpiresIn:    int64(tok.Expiry.Unix()),
+	}, nil
+}
+
+func (p *oauth2Provider) UserInfo(ctx context.Context, tokens *Tokens) (Identity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.userInfoURL, nil)
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%s: userinfo request: %w", p.cfg.name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return Identity{}, fmt.Errorf("%s: userinfo returned %d: %s", p.cfg.name, resp.StatusCode, body)
+	}
+
+	var raw struct {
+		ID      json.Number `json:"id"`
+		Login   string      `json:"login"`
+		Name    string      `json:"name"`
+		Email   string      `json:"email"`
+		Picture string      `json:"avatar_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return Identity{}, fmt.Errorf("%s: decoding userinfo: %w", p.cfg.name, err)
+	}
+
+	name := raw.Name
+	if name == "" {
+		name = raw.Login
+	}
+	email, emailVerified := raw.Email, raw.Email != ""
+	if email == "" && p.emailsURL != "" {
+		email, emailVerified, err = p.primaryEmail(ctx, tokens.AccessToken)
+		if err != nil {
+			return Identity{}, fmt.Errorf("%s: fetching emails: %w", p.cfg.name, err)
+		}
+	}
+	return Identity{
+		Subject:       raw.ID.String(),
+		Email:         email,
+		EmailVerified: emailVerified,
+		Name:          name,
+		Picture:       raw.Picture,
+	}, nil
+}
+
+// primaryEmail falls back to the /user/emails-style endpoint for providers
+// (GitHub) that omit email from the main userinfo response when the
+// account's primary email is private. It picks the verified primary
+// address, or else the first verified address; it returns "" if no
+// address is verified.
+func (p *oauth2Provider) primaryEmail(ctx context.Context, accessToken string) (string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.emailsURL, nil)
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", false, fmt.Errorf("emails request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", false, fmt.Errorf("emails endpoint returned %d: %s", resp.StatusCode, body)
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
+		return "", false, fmt.Errorf("decoding emails: %w", err)
+	}
+	var fallback struct {
+		email    string
+		verified bool
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			return e.Email, true, nil
+		}
+		if fallback.email == "" && e.Verified {
+			fallback.email, fallback.verified = e.Email, true
+		}
+	}
+	return fallback.email, fallback.verified, nil
+}
+
+func (p *oauth2Provider) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	src := p.oauth2.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken})
+	tok, err := src.Token()
+	if err != nil {
+		return nil, fmt.Errorf("%s: refreshing token: %w", p.cfg.name, err)
+	}
+	return &Tokens{
+		AccessToken:  tok.AccessToken,
+		RefreshToken: tok.RefreshToken,
+		ExpiresIn:    int64(tok.Expiry.Unix()),
+	}, nil
+}
@@ -0,0 +1,67 @@
+// Package providers implements social sign-in via OIDC and plain OAuth2,
+// as an alternative (or complement) to the magic-link/OTP passwordless flow.
+package providers
+
+import "context"
+
+// Tokens holds the token set returned by a provider's code exchange.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	ExpiresIn    int64
+}
+
+// Identity is the normalized user profile fetched from a provider after
+// a successful exchange, regardless of whether it came from an ID token
+// or a userinfo endpoint.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+	// Nonce is the nonce claim from the ID token, for providers that are
+	// OIDC-backed. Callers must compare it against the nonce they generated
+	// for this auth attempt. Empty for raw-OAuth2 providers, which have no
+	// ID token and so nothing to check.
+	Nonce string
+}
+
+// Provider is implemented by every social sign-in integration registered
+// with the app (Google, GitHub, Keycloak, Bitbucket, ...).
+type Provider interface {
+	// Name is the route segment used to select this provider, e.g. "google".
+	Name() string
+
+	// AuthURL builds the authorization endpoint URL the browser should be
+	// redirected to. nonce is only meaningful for OIDC providers and may be
+	// empty for raw OAuth2 providers. redirectURI overrides the provider's
+	// default redirect_uri for this call, so the same registered provider
+	// can be used for more than one callback route (e.g. sign-in vs.
+	// account linking); it must be one the IdP has registered as valid.
+	AuthURL(state, nonce, codeVerifier, redirectURI string) string
+
+	// Exchange trades an authorization code for tokens. redirectURI must be
+	// the same value passed to AuthURL for this attempt: providers validate
+	// it matches the one the code was issued for.
+	Exchange(ctx context.Context, code, codeVerifier, redirectURI string) (*Tokens, error)
+
+	// UserInfo resolves the authenticated identity from tokens. OIDC
+	// providers read it from the ID token after verifying it (see
+	// VerifyIDToken); raw OAuth2 providers call their REST userinfo
+	// endpoint with the access token.
+	UserInfo(ctx context.Context, tokens *Tokens) (Identity, error)
+
+	// Refresh exchanges a refresh token for a new token set.
+	Refresh(ctx context.Context, refreshToken string) (*Tokens, error)
+
+	// SupportsPKCE reports whether AuthURL/Exchange expect a PKCE verifier.
+	SupportsPKCE() bool
+
+	// IsOIDC reports whether this provider authenticates via an ID token
+	// (as opposed to a raw OAuth2 + REST userinfo endpoint). Callers must
+	// require and verify Identity.Nonce for OIDC providers; raw OAuth2
+	// providers have no ID token and so nothing to check.
+	IsOIDC() bool
+}
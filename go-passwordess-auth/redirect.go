@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// isValidRedirect reports whether target is safe to 302 a browser to after
+// verification. target must be either:
+//   - a same-site relative path ("/docs"), never a protocol-relative one
+//     ("//evil.com") or a backslash-prefixed lookalike ("/\evil.com",
+//     which browsers normalize the same way as "//evil.com"), or
+//   - an absolute https URL whose host exactly matches an entry in
+//     allowed, or is a subdomain of an entry that starts with ".".
+//
+// Userinfo-bearing URLs (https://user@host/...) and URLs with an explicit
+// port are rejected outright, since neither can be vetted against a bare
+// hostname allow-list.
+func isValidRedirect(target string, allowed []string) bool {
+	if target == "" {
+		return false
+	}
+	if strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//") {
+		if len(target) > 1 && (target[1] == '\\' || target[1] == '/') {
+			return false
+		}
+		return true
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	if u.Scheme != "https" {
+		return false
+	}
+	if u.User != nil {
+		return false
+	}
+	if u.Port() != "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if strings.HasPrefix(entry, ".") {
+			if strings.HasSuffix(host, entry) {
+				return true
+			}
+			continue
+		}
+		if host == entry {
+			return true
+		}
+	}
+	return false
+}
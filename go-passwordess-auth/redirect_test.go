@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestIsValidRedirect(t *testing.T) {
+	allowed := []string{"app.example.com", ".example.com"}
+
+	cases := []struct {
+		name   string
+		target string
+		want   bool
+	}{
+		{"relative path", "/docs", true},
+		{"relative path with query", "/docs?x=1", true},
+		{"empty", "", false},
+		{"protocol-relative", "//evil.com", false},
+		{"backslash lookalike", "/\\evil.com", false},
+		{"open redirect via query param", "https://evil.com?x=good.com", false},
+		{"allowed exact host", "https://app.example.com/path", true},
+		{"allowed subdomain", "https://foo.example.com/path", true},
+		{"disallowed host", "https://evil.com", false},
+		{"non-https scheme", "http://app.example.com", false},
+		{"userinfo", "https://app.example.com@evil.com", false},
+		{"explicit port", "https://app.example.com:8443", false},
+		{"punycode lookalike host not allow-listed", "https://xn--80ak6aa92e.com", false},
+		{"case-insensitive host match", "https://APP.EXAMPLE.COM", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isValidRedirect(tc.target, allowed); got != tc.want {
+				t.Errorf("isValidRedirect(%q) = %v, want %v", tc.target, got, tc.want)
+			}
+		})
+	}
+}
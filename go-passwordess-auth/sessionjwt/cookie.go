@@ -0,0 +1,73 @@
+package sessionjwt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxChunkSize keeps each individual cookie comfortably under the ~4KB
+// per-cookie limit enforced by browsers, leaving room for the cookie's
+// name, attributes and the rest of the request's cookie header.
+const maxChunkSize = 3600
+
+// writeChunked splits value into numbered cookies (name_0, name_1, ...) so
+// that signed sessions carrying several claims plus provider info don't
+// run into the per-cookie size limit. A single-chunk value still gets the
+// "_0" suffix so reads don't need to special-case unsplit cookies.
+func writeChunked(c *fiber.Ctx, name, value string, maxAge int, secure bool) {
+	clearChunked(c, name)
+	for i := 0; len(value) > 0; i++ {
+		end := maxChunkSize
+		if end > len(value) {
+			end = len(value)
+		}
+		chunk := value[:end]
+		value = value[end:]
+		c.Cookie(&fiber.Cookie{
+			Name:     fmt.Sprintf("%s_%d", name, i),
+			Value:    chunk,
+			MaxAge:   maxAge,
+			HTTPOnly: true,
+			Secure:   secure,
+			SameSite: fiber.CookieSameSiteLaxMode,
+			Path:     "/",
+		})
+	}
+}
+
+// readChunked reassembles a value previously split by writeChunked. It
+// stops at the first missing index, so chunks must be contiguous.
+func readChunked(c *fiber.Ctx, name string) string {
+	var b strings.Builder
+	for i := 0; ; i++ {
+		chunk := c.Cookies(fmt.Sprintf("%s_%d", name, i))
+		if chunk == "" {
+			break
+		}
+		b.WriteString(chunk)
+	}
+	return b.String()
+}
+
+// clearChunked expires every chunk cookie for name, up to a generous
+// bound, so a shorter new value doesn't leave stale trailing chunks
+// behind from a previous, longer one.
+func clearChunked(c *fiber.Ctx, name string) {
+	const maxChunks = 16
+	for i := 0; i < maxChunks; i++ {
+		cookieName := fmt.Sprintf("%s_%d", name, i)
+		if c.Cookies(cookieName) == "" {
+			continue
+		}
+		c.Cookie(&fiber.Cookie{
+			Name:     cookieName,
+			Value:    "",
+			MaxAge:   -1,
+			HTTPOnly: true,
+			SameSite: fiber.CookieSameSiteLaxMode,
+			Path:     "/",
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package sessionjwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AccessClaims is the payload carried by the short-lived access JWT.
+type AccessClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// signer signs and parses access JWTs. It prefers HS256 with an
+// operator-supplied secret (SCALEKIT_SESSION_SECRET); if that's unset, it
+// falls back to an RS256 key pair generated at startup, which is fine for
+// local/dev use but means sessions don't survive a restart.
+type signer struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+func newSigner() (*signer, error) {
+	if secret := os.Getenv("SCALEKIT_SESSION_SECRET"); secret != "" {
+		key := []byte(secret)
+		return &signer{method: jwt.SigningMethodHS256, signKey: key, verifyKey: key}, nil
+	}
+	log.Println("SCALEKIT_SESSION_SECRET not set; generating an ephemeral RS256 key (sessions won't survive a restart)")
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("generating session signing key: %w", err)
+	}
+	return &signer{method: jwt.SigningMethodRS256, signKey: key, verifyKey: &key.PublicKey}, nil
+}
+
+func (s *signer) sign(email string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := AccessClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(s.method, claims).SignedString(s.signKey)
+}
+
+func (s *signer) parse(raw string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	token, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != s.method {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Method.Alg())
+		}
+		return s.verifyKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
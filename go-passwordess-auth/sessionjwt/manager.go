@@ -0,0 +1,177 @@
+// Package sessionjwt replaces server-side Fiber sessions for the
+// *authenticated* principal with a pair of cookies: a short-lived signed
+// access JWT and a longer-lived, single-use opaque refresh token tracked
+// server-side for revocation and reuse detection. Unauthenticated,
+// transient flow state (pending email, in-flight auth request ids, OAuth
+// state/nonce) still belongs in the regular Fiber session store.
+package sessionjwt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	accessCookie  = "_sess"
+	refreshCookie = "_refresh"
+
+	defaultAccessTTL  = 10 * time.Minute
+	defaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+var (
+	// ErrNotAuthenticated means no valid access token cookie was present.
+	ErrNotAuthenticated = errors.New("sessionjwt: not authenticated")
+	// ErrInvalidRefreshToken means the refresh cookie is missing, unknown,
+	// expired or revoked.
+	ErrInvalidRefreshToken = errors.New("sessionjwt: invalid refresh token")
+	// ErrRefreshReuseDetected means a refresh token that had already been
+	// rotated was presented again, which means it (or its successor) was
+	// likely stolen. The whole chain is revoked when this happens.
+	ErrRefreshReuseDetected = errors.New("sessionjwt: refresh token reuse detected")
+)
+
+// Manager issues, validates and rotates signed-JWT sessions.
+type Manager struct {
+	signer     *signer
+	store      RefreshStore
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	secure     bool
+}
+
+// NewManager builds a Manager backed by store. Cookies are marked Secure
+// unless SCALEKIT_COOKIE_INSECURE=true, which is only meant for local
+// development over plain HTTP.
+func NewManager(store RefreshStore) (*Manager, error) {
+	s, err := newSigner()
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{
+		signer:     s,
+		store:      store,
+		accessTTL:  defaultAccessTTL,
+		refreshTTL: defaultRefreshTTL,
+		secure:     os.Getenv("SCALEKIT_COOKIE_INSECURE") != "true",
+	}, nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IssueSession signs a fresh access token and mints a new refresh token
+// for email, writing both as cookies (chunked via writeChunked, so a
+// value over the 4KB single-cookie limit is split across cookies).
+func (m *Manager) IssueSession(c *fiber.Ctx, email string) error {
+	access, err := m.signer.sign(email, m.accessTTL)
+	if err != nil {
+		return err
+	}
+	refresh, err := randomToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := m.store.Create(RefreshRecord{
+		TokenHash: hashToken(refresh),
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.refreshTTL),
+	}); err != nil {
+		return err
+	}
+	writeChunked(c, accessCookie, access, int(m.accessTTL.Seconds()), m.secure)
+	writeChunked(c, refreshCookie, refresh, int(m.refreshTTL.Seconds()), m.secure)
+	return nil
+}
+
+// Authenticate validates the access token cookie and returns the email it
+// was issued for.
+func (m *Manager) Authenticate(c *fiber.Ctx) (string, error) {
+	raw := readChunked(c, accessCookie)
+	if raw == "" {
+		return "", ErrNotAuthenticated
+	}
+	claims, err := m.signer.parse(raw)
+	if err != nil {
+		return "", ErrNotAuthenticated
+	}
+	return claims.Email, nil
+}
+
+// Refresh rotates the refresh token cookie, issuing a new access+refresh
+// pair. The presented refresh token is single-use: if it's presented
+// again after being rotated, that's treated as reuse (e.g. a stolen,
+// replayed cookie) and the whole token chain is revoked.
+func (m *Manager) Refresh(c *fiber.Ctx) (string, error) {
+	raw := readChunked(c, refreshCookie)
+	if raw == "" {
+		return "", ErrInvalidRefreshToken
+	}
+	hash := hashToken(raw)
+	rec, found, err := m.store.Get(hash)
+	if err != nil {
+		return "", err
+	}
+	if !found || rec.Revoked || time.Now().After(rec.ExpiresAt) {
+		return "", ErrInvalidRefreshToken
+	}
+	if rec.ReplacedBy != "" {
+		_ = m.store.RevokeChain(hash)
+		return "", ErrRefreshReuseDetected
+	}
+
+	next, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	nextRec := RefreshRecord{
+		TokenHash: hashToken(next),
+		Email:     rec.Email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.refreshTTL),
+	}
+	if err := m.store.Rotate(hash, nextRec); err != nil {
+		return "", err
+	}
+
+	access, err := m.signer.sign(rec.Email, m.accessTTL)
+	if err != nil {
+		return "", err
+	}
+	writeChunked(c, accessCookie, access, int(m.accessTTL.Seconds()), m.secure)
+	writeChunked(c, refreshCookie, next, int(m.refreshTTL.Seconds()), m.secure)
+	return rec.Email, nil
+}
+
+// Revoke deletes the server-side refresh record for whatever refresh
+// cookie is present and clears both session cookies. Used by /logout.
+func (m *Manager) Revoke(c *fiber.Ctx) error {
+	if raw := readChunked(c, refreshCookie); raw != "" {
+		if err := m.store.Revoke(hashToken(raw)); err != nil {
+			return err
+		}
+	}
+	clearChunked(c, accessCookie)
+	clearChunked(c, refreshCookie)
+	return nil
+}
@@ -0,0 +1,21 @@
+package sessionjwt
+
+import "github.com/gofiber/fiber/v2"
+
+// LocalsEmailKey is the fiber.Ctx Locals key RequireAuth stores the
+// authenticated email under.
+const LocalsEmailKey = "sessionjwt:email"
+
+// RequireAuth is Fiber middleware that rejects requests without a valid
+// access token cookie, and otherwise makes the authenticated email
+// available via c.Locals(LocalsEmailKey).
+func (m *Manager) RequireAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		email, err := m.Authenticate(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Not authorized"})
+		}
+		c.Locals(LocalsEmailKey, email)
+		return c.Next()
+	}
+}
@@ -0,0 +1,34 @@
+package sessionjwt
+
+import "time"
+
+// RefreshRecord is the server-side record backing a single refresh token.
+// Only a hash of the token is ever stored, never the token itself.
+type RefreshRecord struct {
+	TokenHash  string
+	Email      string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	Revoked    bool
+	ReplacedBy string // set once this record has been rotated to a new token
+}
+
+// RefreshStore persists refresh-token records so that refresh can be a
+// single-use, revocable operation instead of a bare bearer token. Rotate
+// must be atomic: it both retires oldHash and inserts next in one step so
+// a replay of oldHash after rotation is detectable as reuse.
+type RefreshStore interface {
+	Create(rec RefreshRecord) error
+	Get(tokenHash string) (RefreshRecord, bool, error)
+	Rotate(oldHash string, next RefreshRecord) error
+	Revoke(tokenHash string) error
+
+	// RevokeChain revokes tokenHash and every token it was ever rotated
+	// into, following ReplacedBy all the way to the current end of the
+	// chain. Used on reuse detection: a replayed token means everything
+	// descending from it (including whatever is currently active) may be
+	// in an attacker's hands.
+	RevokeChain(tokenHash string) error
+
+	Close() error
+}
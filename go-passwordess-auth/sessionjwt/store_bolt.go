@@ -0,0 +1,147 @@
+package sessionjwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var refreshBucket = []byte("refresh_tokens")
+
+// BoltStore is the default RefreshStore: a small embedded, file-backed
+// table keyed by the hashed token id, so a leaked log line or DB dump
+// never reveals a usable token.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens (creating if necessary) a bolt database at path and
+// ensures the refresh token bucket exists.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening refresh token store %q: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(refreshBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing refresh token store: %w", err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Create(rec RefreshRecord) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(refreshBucket).Put([]byte(rec.TokenHash), data)
+	})
+}
+
+func (s *BoltStore) Get(tokenHash string) (RefreshRecord, bool, error) {
+	var rec RefreshRecord
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(refreshBucket).Get([]byte(tokenHash))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &rec)
+	})
+	return rec, found, err
+}
+
+// Rotate atomically marks oldHash as replaced and inserts next, so a
+// replay of oldHash after this call is detectable reuse rather than a
+// silent double-issue of tokens.
+func (s *BoltStore) Rotate(oldHash string, next RefreshRecord) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(refreshBucket)
+		data := b.Get([]byte(oldHash))
+		if data == nil {
+			return fmt.Errorf("refresh token not found")
+		}
+		var old RefreshRecord
+		if err := json.Unmarshal(data, &old); err != nil {
+			return err
+		}
+		old.ReplacedBy = next.TokenHash
+		oldData, err := json.Marshal(old)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(oldHash), oldData); err != nil {
+			return err
+		}
+		nextData, err := json.Marshal(next)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(next.TokenHash), nextData)
+	})
+}
+
+func (s *BoltStore) Revoke(tokenHash string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(refreshBucket)
+		data := b.Get([]byte(tokenHash))
+		if data == nil {
+			return nil
+		}
+		var rec RefreshRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+		rec.Revoked = true
+		out, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(tokenHash), out)
+	})
+}
+
+// RevokeChain revokes tokenHash and follows ReplacedBy forward, revoking
+// every descendant so a replayed token can't leave a later link in the
+// same rotation chain still usable. visited guards against a corrupt
+// cycle turning this into an infinite loop.
+func (s *BoltStore) RevokeChain(tokenHash string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(refreshBucket)
+		visited := make(map[string]bool)
+		hash := tokenHash
+		for hash != "" && !visited[hash] {
+			visited[hash] = true
+			data := b.Get([]byte(hash))
+			if data == nil {
+				return nil
+			}
+			var rec RefreshRecord
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return err
+			}
+			rec.Revoked = true
+			out, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(hash), out); err != nil {
+				return err
+			}
+			hash = rec.ReplacedBy
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,65 @@
+package tokenstore
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process Store, useful for tests and for running
+// the app without a configured database file.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+func (s *MemoryStore) Upsert(rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[rec.Email] = rec
+	return nil
+}
+
+func (s *MemoryStore) Get(email string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[email]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return rec, nil
+}
+
+func (s *MemoryStore) IncrementAttempts(email string, maxAttempts int) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[email]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	rec.Attempts++
+	if rec.Attempts >= maxAttempts {
+		rec.Locked = true
+	}
+	s.records[email] = rec
+	return rec, nil
+}
+
+func (s *MemoryStore) MarkConsumed(email string, via Type) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[email]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now()
+	rec.ConsumedAt = &now
+	rec.Type = via
+	s.records[email] = rec
+	return nil
+}
+
+func (s *MemoryStore) Close() error { return nil }
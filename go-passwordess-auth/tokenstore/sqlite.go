@@ -0,0 +1,138 @@
+package tokenstore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore is the default Store for production use: a single table
+// keyed by email, so restarting the app doesn't forget in-flight auth
+// requests or reset throttling.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStore opens (creating if necessary) a sqlite database at path
+// and ensures the auth_tokens table exists.
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("opening token store %q: %w", path, err)
+	}
+	const schema = `
+	CREATE TABLE IF NOT EXISTS auth_tokens (
+		email           TEXT PRIMARY KEY,
+		auth_request_id TEXT NOT NULL,
+		type            TEXT NOT NULL,
+		created_at      INTEGER NOT NULL,
+		expires_at      INTEGER NOT NULL,
+		attempts        INTEGER NOT NULL DEFAULT 0,
+		locked          INTEGER NOT NULL DEFAULT 0,
+		last_sent_at    INTEGER NOT NULL,
+		send_count      INTEGER NOT NULL DEFAULT 1,
+		window_start    INTEGER NOT NULL,
+		consumed_at     INTEGER
+	);`
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing token store schema: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Upsert(rec Record) error {
+	var consumedAt *int64
+	if rec.ConsumedAt != nil {
+		t := rec.ConsumedAt.Unix()
+		consumedAt = &t
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO auth_tokens (email, auth_request_id, type, created_at, expires_at, attempts, locked, last_sent_at, send_count, window_start, consumed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(email) DO UPDATE SET
+			auth_request_id = excluded.auth_request_id,
+			type            = excluded.type,
+			created_at      = excluded.created_at,
+			expires_at      = excluded.expires_at,
+			attempts        = excluded.attempts,
+			locked          = excluded.locked,
+			last_sent_at    = excluded.last_sent_at,
+			send_count      = excluded.send_count,
+			window_start    = excluded.window_start,
+			consumed_at     = excluded.consumed_at`,
+		rec.Email, rec.AuthRequestId, string(rec.Type), rec.CreatedAt.Unix(), rec.ExpiresAt.Unix(),
+		rec.Attempts, rec.Locked, rec.LastSentAt.Unix(), rec.SendCount, rec.WindowStart.Unix(), consumedAt,
+	)
+	return err
+}
+
+func (s *SQLiteStore) Get(email string) (Record, error) {
+	row := s.db.QueryRow(`
+		SELECT email, auth_request_id, type, created_at, expires_at, attempts, locked, last_sent_at, send_count, window_start, consumed_at
+		FROM auth_tokens WHERE email = ?`, email)
+	return scanRecord(row)
+}
+
+func (s *SQLiteStore) IncrementAttempts(email string, maxAttempts int) (Record, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Record{}, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow(`
+		SELECT email, auth_request_id, type, created_at, expires_at, attempts, locked, last_sent_at, send_count, window_start, consumed_at
+		FROM auth_tokens WHERE email = ?`, email)
+	rec, err := scanRecord(row)
+	if err != nil {
+		return Record{}, err
+	}
+	rec.Attempts++
+	if rec.Attempts >= maxAttempts {
+		rec.Locked = true
+	}
+	if _, err := tx.Exec(`UPDATE auth_tokens SET attempts = ?, locked = ? WHERE email = ?`, rec.Attempts, rec.Locked, email); err != nil {
+		return Record{}, err
+	}
+	return rec, tx.Commit()
+}
+
+func (s *SQLiteStore) MarkConsumed(email string, via Type) error {
+	_, err := s.db.Exec(`UPDATE auth_tokens SET consumed_at = ?, type = ? WHERE email = ?`, time.Now().Unix(), string(via), email)
+	return err
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRecord(row rowScanner) (Record, error) {
+	var rec Record
+	var typ string
+	var createdAt, expiresAt, lastSentAt, windowStart int64
+	var consumedAt sql.NullInt64
+	err := row.Scan(&rec.Email, &rec.AuthRequestId, &typ, &createdAt, &expiresAt, &rec.Attempts, &rec.Locked, &lastSentAt, &rec.SendCount, &windowStart, &consumedAt)
+	if err == sql.ErrNoRows {
+		return Record{}, ErrNotFound
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	rec.Type = Type(typ)
+	rec.CreatedAt = time.Unix(createdAt, 0)
+	rec.ExpiresAt = time.Unix(expiresAt, 0)
+	rec.LastSentAt = time.Unix(lastSentAt, 0)
+	rec.WindowStart = time.Unix(windowStart, 0)
+	if consumedAt.Valid {
+		t := time.Unix(consumedAt.Int64, 0)
+		rec.ConsumedAt = &t
+	}
+	return rec, nil
+}
@@ -0,0 +1,67 @@
+// Package tokenstore tracks in-flight passwordless auth requests per
+// email, so /request-auth can throttle repeat sends, /resend-auth can
+// reuse a still-valid auth request instead of minting a new one, and
+// /verify-otp can lock out an email after too many bad attempts.
+package tokenstore
+
+import (
+	"errors"
+	"time"
+)
+
+// Type distinguishes which passwordless flow redeemed a Record. The same
+// auth_request_id backs both the OTP and magic-link emails Scalekit sends,
+// so which one actually gets used isn't known until verification
+// succeeds; Type is empty until then.
+type Type string
+
+const (
+	TypeMagicLink Type = "magiclink"
+	TypeOTP       Type = "otp"
+)
+
+// ErrNotFound is returned by Get when no record exists for an email.
+var ErrNotFound = errors.New("tokenstore: no record for email")
+
+// Record is the server-side bookkeeping for one email's in-flight (or
+// most recently completed) passwordless auth request.
+type Record struct {
+	Email         string
+	AuthRequestId string
+	Type          Type
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	Attempts      int
+	Locked        bool
+	LastSentAt    time.Time
+	SendCount     int       // sends within the current rolling window
+	WindowStart   time.Time // start of the current rolling window
+	ConsumedAt    *time.Time
+}
+
+// Expired reports whether the underlying auth request can no longer be verified.
+func (r Record) Expired() bool { return time.Now().After(r.ExpiresAt) }
+
+// Consumed reports whether this record's token has already been used.
+func (r Record) Consumed() bool { return r.ConsumedAt != nil }
+
+// Store persists Records keyed by email. Implementations must make
+// IncrementAttempts atomic with respect to concurrent verify attempts for
+// the same email, since it's what enforces the lockout.
+type Store interface {
+	// Upsert replaces whatever record exists for rec.Email, e.g. after a
+	// fresh /request-auth send.
+	Upsert(rec Record) error
+
+	Get(email string) (Record, error)
+
+	// IncrementAttempts bumps Attempts for email by one, locking the
+	// record once it reaches maxAttempts, and returns the updated record.
+	IncrementAttempts(email string, maxAttempts int) (Record, error)
+
+	// MarkConsumed sets ConsumedAt to now (so the token can't be replayed)
+	// and records via as the flow that actually redeemed it.
+	MarkConsumed(email string, via Type) error
+
+	Close() error
+}